@@ -2,15 +2,43 @@ package buff
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
 	"sync"
+	"time"
 )
 
 var (
-	errSize = errors.New("error: size of buff must be greater than 0")
-	errMode = errors.New("error: invalid search mode specified")
+	errSize              = errors.New("error: size of buff must be greater than 0")
+	errMode              = errors.New("error: invalid search mode specified")
+	errFalsePositiveRate = errors.New("error: false positive rate must be between 0 and 1")
+	errSnapshotMode      = errors.New("error: Snapshot only supports Recent and Oldest raw-byte buffers without a TTL")
+	errSnapshotMagic     = errors.New("error: not a buff snapshot (bad magic)")
+	errSnapshotVersion   = errors.New("error: unsupported snapshot version")
+	errSnapshotCorrupt   = errors.New("error: corrupt snapshot (CRC32 mismatch)")
+	errSnapshotMismatch  = errors.New("error: snapshot size or mode does not match OpenFile's parameters")
+	errTTL               = errors.New("error: ttl must be greater than 0")
 )
 
+// snapshotMagic identifies the start of a framed Buff snapshot.
+var snapshotMagic = [4]byte{'B', 'U', 'F', 'F'}
+
+// snapshotVersion is the current snapshot format version written by
+// Snapshot and expected by Restore.
+const snapshotVersion = 1
+
+// maxCounter is the saturation point for a counting Bloom filter bucket.
+// Buckets stop incrementing (and are never decremented) once they hit this
+// value, trading a small amount of eviction precision for a single byte per
+// bucket.
+const maxCounter = 15
+
 // Mode represents the search mode.
 type Mode uint8
 
@@ -19,6 +47,9 @@ const (
 	Recent Mode = 0
 	// Oldest searches the buffer from the oldest to most recent element.
 	Oldest Mode = 1
+	// Probabilistic backs Add and Test with a counting Bloom filter instead
+	// of a linear scan, trading an exact answer for O(k) membership checks.
+	Probabilistic Mode = 2
 )
 
 // Buff contains the information for the circular buffer.
@@ -28,6 +59,34 @@ type Buff struct {
 	ptr   int           // pointer to last added data point
 	data  [][]byte      // byte store of buffer
 	mutex *sync.RWMutex // mutex for locking Add, Test, and Reset operations
+
+	// counters, numHashes, numBits, and indexRing are only populated when
+	// mode is Probabilistic; they implement a counting Bloom filter over the
+	// same circular capacity as data.
+	counters  []uint8
+	numHashes int
+	numBits   uint64
+	indexRing [][]uint64
+
+	// hashed, hasher, and digest are only populated when the buffer was
+	// created with InitHashed; data is left unused so the buffer retains only
+	// a fixed-size digest per entry instead of the raw payload.
+	hashed bool
+	hasher func([]byte) [32]byte
+	digest [][32]byte
+
+	// ttl, timestamps, clock, and sweepStop are only populated when the
+	// buffer was created with InitWithTTL or InitWithTTLAuto; they bound how
+	// long an entry remains a member regardless of its ring position. ttl of
+	// zero disables expiration.
+	ttl        time.Duration
+	timestamps []int64
+	clock      func() time.Time
+	sweepStop  chan struct{}
+
+	// path is only set when the buffer was created with OpenFile; every Add
+	// checkpoints the full buffer back to this path.
+	path string
 }
 
 // Init initializes and returns a new circular buffer. If the size is less than
@@ -50,12 +109,233 @@ func Init(size int, mode Mode) (*Buff, error) {
 	return &b, nil
 }
 
+// defaultHasher is the digest function used by InitHashed when none is
+// provided.
+func defaultHasher(data []byte) [32]byte {
+	return sha256.Sum256(data)
+}
+
+// InitHashed initializes and returns a new circular buffer that retains only
+// a fixed-size digest of each entry rather than the raw bytes, so buffer
+// memory stays proportional to size regardless of payload length. hasher
+// defaults to SHA-256 if nil. If the size is less than one, or if an
+// incorrect mode is provided, an error will be returned.
+func InitHashed(size int, mode Mode, hasher func([]byte) [32]byte) (*Buff, error) {
+	if size < 1 {
+		return nil, errSize
+	}
+	if mode != Recent && mode != Oldest {
+		return nil, errMode
+	}
+	if hasher == nil {
+		hasher = defaultHasher
+	}
+
+	b := Buff{}
+	b.size = size
+	b.mode = mode
+	b.ptr = 0
+	b.mutex = &sync.RWMutex{}
+	b.hashed = true
+	b.hasher = hasher
+	b.digest = make([][32]byte, size)
+
+	return &b, nil
+}
+
+// InitWithTTL initializes and returns a new circular buffer where entries
+// older than ttl are treated as absent by Test and GetOldest, even while
+// still physically present in the ring. Call Sweep periodically (or use
+// InitWithTTLAuto) to proactively zero out expired slots. If the size is
+// less than one, or if an incorrect mode is provided, an error will be
+// returned.
+func InitWithTTL(size int, mode Mode, ttl time.Duration) (*Buff, error) {
+	if size < 1 {
+		return nil, errSize
+	}
+	if mode != Recent && mode != Oldest {
+		return nil, errMode
+	}
+
+	b := Buff{}
+	b.size = size
+	b.mode = mode
+	b.ptr = 0
+	b.data = make([][]byte, size)
+	b.mutex = &sync.RWMutex{}
+	b.ttl = ttl
+	b.timestamps = make([]int64, size)
+	b.clock = time.Now
+
+	return &b, nil
+}
+
+// InitWithTTLAuto is InitWithTTL plus a background goroutine that calls
+// Sweep once per ttl to proactively zero out expired slots rather than
+// waiting for Test or GetOldest to observe them. Call StopSweep to stop the
+// goroutine when the buffer is no longer needed. Unlike InitWithTTL, ttl
+// must be positive here since it also drives the sweep interval.
+func InitWithTTLAuto(size int, mode Mode, ttl time.Duration) (*Buff, error) {
+	if ttl <= 0 {
+		return nil, errTTL
+	}
+
+	b, err := InitWithTTL(size, mode, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	b.sweepStop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.Sweep()
+			case <-b.sweepStop:
+				return
+			}
+		}
+	}()
+
+	return b, nil
+}
+
+// StopSweep stops the background sweep goroutine started by
+// InitWithTTLAuto. It is a no-op for buffers created any other way.
+func (b *Buff) StopSweep() {
+	if b.sweepStop != nil {
+		close(b.sweepStop)
+	}
+}
+
+// Sweep zeros out any slot whose entry has outlived the buffer's ttl. It is
+// a no-op if the buffer was not created with a TTL.
+func (b *Buff) Sweep() {
+	if b.ttl <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	for i := 0; i < b.size; i++ {
+		if b.data[i] != nil && b.expired(i) {
+			b.data[i] = nil
+			b.timestamps[i] = 0
+		}
+	}
+	b.mutex.Unlock()
+}
+
+// expired reports whether the entry at index i has outlived the buffer's
+// ttl. Callers must hold b.mutex (read or write). ttl of zero disables
+// expiration.
+func (b *Buff) expired(i int) bool {
+	if b.ttl <= 0 {
+		return false
+	}
+	return b.clock().UnixNano()-b.timestamps[i] > int64(b.ttl)
+}
+
+// InitProbabilistic initializes and returns a new circular buffer whose
+// membership check is backed by a counting Bloom filter rather than a linear
+// scan, so Add and Test run in O(k) time (k being the number of hash
+// functions) instead of O(n). The bit array is sized from capacity and
+// falsePositiveRate using the standard Bloom filter formulas. An error is
+// returned if capacity is less than one or falsePositiveRate is not in
+// (0, 1).
+func InitProbabilistic(capacity int, falsePositiveRate float64) (*Buff, error) {
+	if capacity < 1 {
+		return nil, errSize
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errFalsePositiveRate
+	}
+
+	m := bloomBits(capacity, falsePositiveRate)
+	k := bloomHashes(m, capacity)
+
+	b := Buff{}
+	b.size = capacity
+	b.mode = Probabilistic
+	b.ptr = 0
+	b.data = make([][]byte, capacity)
+	b.mutex = &sync.RWMutex{}
+	b.counters = make([]uint8, m)
+	b.numHashes = k
+	b.numBits = m
+	b.indexRing = make([][]uint64, capacity)
+
+	return &b, nil
+}
+
+// bloomBits sizes the Bloom filter bit array for capacity elements at the
+// given false positive rate: m = ceil(-capacity * ln(p) / (ln2)^2).
+func bloomBits(capacity int, p float64) uint64 {
+	m := math.Ceil(-float64(capacity) * math.Log(p) / (math.Ln2 * math.Ln2))
+	if m < 1 {
+		m = 1
+	}
+	return uint64(m)
+}
+
+// bloomHashes picks the number of hash functions for an m-bit filter holding
+// capacity elements: k = round((m/capacity) * ln2).
+func bloomHashes(m uint64, capacity int) int {
+	k := math.Round((float64(m) / float64(capacity)) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return int(k)
+}
+
+// bloomIndices derives b.numHashes bucket indices for key via double hashing
+// h_i(x) = h1(x) + i*h2(x). h1 and h2 come from the FNV-1a and FNV-1
+// variants (genuinely different mixing, not just a perturbed input) and
+// sum2 is forced odd so the stride can't settle onto a single parity of
+// b.numBits and clump half the filter's keys into one half of the bit
+// array.
+func (b *Buff) bloomIndices(key []byte) []uint64 {
+	h1 := fnv.New64a()
+	h1.Write(key)
+	sum1 := h1.Sum64()
+
+	h2 := fnv.New64()
+	h2.Write(key)
+	sum2 := h2.Sum64() | 1
+
+	indices := make([]uint64, b.numHashes)
+	for i := 0; i < b.numHashes; i++ {
+		indices[i] = (sum1 + uint64(i)*sum2) % b.numBits
+	}
+	return indices
+}
+
 // Add adds data to the buffer.
 func (b *Buff) Add(data []byte) {
 	b.mutex.Lock()
 
-	// add data and increment pointer
-	b.data[b.ptr] = data
+	if b.mode == Probabilistic {
+		b.addProbabilistic(data)
+		b.mutex.Unlock()
+		return
+	}
+
+	if b.hashed {
+		b.digest[b.ptr] = b.hasher(data)
+	} else {
+		// copy so the caller can't mutate the slice after Add and silently
+		// change buffer contents
+		raw := make([]byte, len(data))
+		copy(raw, data)
+		b.data[b.ptr] = raw
+	}
+
+	if b.ttl > 0 {
+		b.timestamps[b.ptr] = b.clock().UnixNano()
+	}
+
+	// increment pointer
 	b.ptr++
 
 	// wrap pointer back if at end
@@ -63,11 +343,59 @@ func (b *Buff) Add(data []byte) {
 		b.ptr = 0
 	}
 
+	if b.path != "" {
+		// best effort: Add has no error return, so a failed checkpoint is
+		// dropped; the in-memory buffer is still correct
+		_ = b.checkpoint()
+	}
+
 	b.mutex.Unlock()
 }
 
+// addProbabilistic inserts data into the counting Bloom filter at b.ptr,
+// first decrementing the counters owned by the slot being evicted. Callers
+// must hold b.mutex.
+func (b *Buff) addProbabilistic(data []byte) {
+	// evict the slot's previous counters (if not saturated, where the true
+	// count is no longer known)
+	for _, idx := range b.indexRing[b.ptr] {
+		if b.counters[idx] > 0 && b.counters[idx] < maxCounter {
+			b.counters[idx]--
+		}
+	}
+
+	indices := b.bloomIndices(data)
+	for _, idx := range indices {
+		if b.counters[idx] < maxCounter {
+			b.counters[idx]++
+		}
+	}
+
+	// copy so the caller can't mutate the slice after Add and silently
+	// change buffer contents, same as the raw-mode branch in Add
+	raw := make([]byte, len(data))
+	copy(raw, data)
+	b.data[b.ptr] = raw
+	b.indexRing[b.ptr] = indices
+
+	b.ptr++
+	if b.ptr == b.size {
+		b.ptr = 0
+	}
+}
+
 // Test returns a bool if the data is in the buffer.
 func (b *Buff) Test(key []byte) bool {
+	if b.mode == Probabilistic {
+		return b.testProbabilistic(key)
+	}
+	if b.hashed {
+		digest := b.hasher(key)
+		if b.mode == Oldest {
+			return b.testOldestHashed(digest)
+		}
+		return b.testRecentHashed(digest)
+	}
 	if b.mode == Oldest {
 		return b.testOldest(key)
 	}
@@ -79,11 +407,27 @@ func (b *Buff) Reset() {
 	b.mutex.Lock()
 	b.data = make([][]byte, b.size)
 	b.ptr = 0
+	if b.mode == Probabilistic {
+		b.counters = make([]uint8, b.numBits)
+		b.indexRing = make([][]uint64, b.size)
+	}
+	if b.hashed {
+		b.digest = make([][32]byte, b.size)
+	}
+	if b.ttl > 0 {
+		b.timestamps = make([]int64, b.size)
+	}
 	b.mutex.Unlock()
 }
 
-// GetRecent returns the most recent element.
+// GetRecent returns the most recent element. In hashed mode this returns the
+// stored digest rather than the original bytes, which are not retained, so
+// GetRecentRaw returns nil there.
 func (b *Buff) GetRecent() []byte {
+	if b.hashed {
+		return b.getRecentHashed()
+	}
+
 	b.mutex.RLock()
 	var buff []byte
 
@@ -110,15 +454,50 @@ func (b *Buff) GetRecent() []byte {
 	return buff
 }
 
+// GetRecentRaw returns the original bytes behind the most recent element, or
+// nil if the buffer is in hashed mode, since the original bytes are not
+// retained there.
+func (b *Buff) GetRecentRaw() []byte {
+	if b.hashed {
+		return nil
+	}
+	return b.GetRecent()
+}
+
+// getRecentHashed returns the digest of the most recent element, or nil if
+// the buffer is empty.
+func (b *Buff) getRecentHashed() []byte {
+	b.mutex.RLock()
+
+	idx := b.ptr - 1
+	if idx < 0 {
+		idx = b.size - 1
+	}
+	digest := b.digest[idx]
+	b.mutex.RUnlock()
+
+	if digest == ([32]byte{}) {
+		return nil
+	}
+	buff := make([]byte, 32)
+	copy(buff, digest[:])
+	return buff
+}
+
 // GetOldest returns the oldest element. Nil is returned if all of the data is
-// nil.
+// nil. In hashed mode this returns the stored digest rather than the
+// original bytes, which are not retained, so GetOldestRaw returns nil there.
 func (b *Buff) GetOldest() []byte {
+	if b.hashed {
+		return b.getOldestHashed()
+	}
+
 	b.mutex.RLock()
 	var buff []byte
 
 	// pointer to end (scanning right)
 	for i := b.ptr; i < b.size; i++ {
-		if b.data[i] != nil {
+		if b.data[i] != nil && !b.expired(i) {
 			data := b.data[i]
 			buff = make([]byte, len(data))
 			copy(buff, data)
@@ -129,7 +508,7 @@ func (b *Buff) GetOldest() []byte {
 
 	// start to pointer (scanning right)
 	for i := 0; i < b.ptr; i++ {
-		if b.data[i] != nil {
+		if b.data[i] != nil && !b.expired(i) {
 			data := b.data[i]
 			buff = make([]byte, len(data))
 			copy(buff, data)
@@ -142,6 +521,43 @@ func (b *Buff) GetOldest() []byte {
 	return nil
 }
 
+// GetOldestRaw returns the original bytes behind the oldest element, or nil
+// if the buffer is in hashed mode, since the original bytes are not retained
+// there.
+func (b *Buff) GetOldestRaw() []byte {
+	if b.hashed {
+		return nil
+	}
+	return b.GetOldest()
+}
+
+// getOldestHashed returns the digest of the oldest element. Nil is returned
+// if all of the digests are unset (the buffer is empty).
+func (b *Buff) getOldestHashed() []byte {
+	b.mutex.RLock()
+
+	for i := b.ptr; i < b.size; i++ {
+		if b.digest[i] != ([32]byte{}) {
+			buff := make([]byte, 32)
+			copy(buff, b.digest[i][:])
+			b.mutex.RUnlock()
+			return buff
+		}
+	}
+
+	for i := 0; i < b.ptr; i++ {
+		if b.digest[i] != ([32]byte{}) {
+			buff := make([]byte, 32)
+			copy(buff, b.digest[i][:])
+			b.mutex.RUnlock()
+			return buff
+		}
+	}
+
+	b.mutex.RUnlock()
+	return nil
+}
+
 // testRecent tests for the key in the buffer, starting at the most recent
 // element.
 func (b *Buff) testRecent(key []byte) bool {
@@ -149,7 +565,32 @@ func (b *Buff) testRecent(key []byte) bool {
 
 	// pointer to start (scanning left)
 	for i := b.ptr - 1; i >= 0; i-- {
-		if bytes.Equal(key, b.data[i]) {
+		if bytes.Equal(key, b.data[i]) && !b.expired(i) {
+			b.mutex.RUnlock()
+			return true
+		}
+	}
+
+	// end to pointer (scanning left)
+	for i := b.size - 1; i >= b.ptr; i-- {
+		if bytes.Equal(key, b.data[i]) && !b.expired(i) {
+			b.mutex.RUnlock()
+			return true
+		}
+	}
+
+	b.mutex.RUnlock()
+	return false
+}
+
+// testRecentHashed tests for the digest in the buffer, starting at the most
+// recent element.
+func (b *Buff) testRecentHashed(digest [32]byte) bool {
+	b.mutex.RLock()
+
+	// pointer to start (scanning left)
+	for i := b.ptr - 1; i >= 0; i-- {
+		if b.digest[i] == digest {
 			b.mutex.RUnlock()
 			return true
 		}
@@ -157,7 +598,7 @@ func (b *Buff) testRecent(key []byte) bool {
 
 	// end to pointer (scanning left)
 	for i := b.size - 1; i >= b.ptr; i-- {
-		if bytes.Equal(key, b.data[i]) {
+		if b.digest[i] == digest {
 			b.mutex.RUnlock()
 			return true
 		}
@@ -167,13 +608,55 @@ func (b *Buff) testRecent(key []byte) bool {
 	return false
 }
 
+// testOldestHashed tests for the digest in the buffer, starting at the
+// oldest element.
+func (b *Buff) testOldestHashed(digest [32]byte) bool {
+	b.mutex.RLock()
+
+	// pointer to end (scanning right)
+	for i := b.ptr; i < b.size; i++ {
+		if b.digest[i] == digest {
+			b.mutex.RUnlock()
+			return true
+		}
+	}
+
+	// start to pointer (scanning right)
+	for i := 0; i < b.ptr; i++ {
+		if b.digest[i] == digest {
+			b.mutex.RUnlock()
+			return true
+		}
+	}
+
+	b.mutex.RUnlock()
+	return false
+}
+
+// testProbabilistic tests for the key's membership in the counting Bloom
+// filter. It returns true iff every one of the key's bucket indices is
+// non-zero, so it may report false positives but never false negatives.
+func (b *Buff) testProbabilistic(key []byte) bool {
+	b.mutex.RLock()
+
+	for _, idx := range b.bloomIndices(key) {
+		if b.counters[idx] == 0 {
+			b.mutex.RUnlock()
+			return false
+		}
+	}
+
+	b.mutex.RUnlock()
+	return true
+}
+
 // testOldest tests for the key in the buffer, starting at the oldest element.
 func (b *Buff) testOldest(key []byte) bool {
 	b.mutex.RLock()
 
 	// pointer to end (scanning right)
 	for i := b.ptr; i < b.size; i++ {
-		if bytes.Equal(key, b.data[i]) {
+		if bytes.Equal(key, b.data[i]) && !b.expired(i) {
 			b.mutex.RUnlock()
 			return true
 		}
@@ -181,7 +664,7 @@ func (b *Buff) testOldest(key []byte) bool {
 
 	// start to pointer (scanning right)
 	for i := 0; i < b.ptr; i++ {
-		if bytes.Equal(key, b.data[i]) {
+		if bytes.Equal(key, b.data[i]) && !b.expired(i) {
 			b.mutex.RUnlock()
 			return true
 		}
@@ -190,3 +673,203 @@ func (b *Buff) testOldest(key []byte) bool {
 	b.mutex.RUnlock()
 	return false
 }
+
+// OpenFile opens or creates a file-backed circular buffer at path, so its
+// contents survive process restarts. If path already holds a valid
+// snapshot, it is loaded (and must match size and mode); otherwise a fresh
+// buffer is created. Every subsequent Add checkpoints the full buffer back
+// to path. Only the Recent and Oldest raw-byte modes are supported.
+func OpenFile(path string, size int, mode Mode) (*Buff, error) {
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		b, err := Init(size, mode)
+		if err != nil {
+			return nil, err
+		}
+		b.path = path
+		return b, nil
+	case err != nil:
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err := Restore(f)
+	if err != nil {
+		return nil, err
+	}
+	if b.size != size || b.mode != mode {
+		return nil, errSnapshotMismatch
+	}
+	b.path = path
+
+	return b, nil
+}
+
+// checkpoint persists the buffer to its backing file (set by OpenFile) by
+// writing a fresh snapshot to a temp file and renaming it into place, so a
+// crash mid-write never corrupts the existing file. Callers must hold
+// b.mutex.
+func (b *Buff) checkpoint() error {
+	tmp := b.path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := b.snapshotLocked(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, b.path)
+}
+
+// Snapshot writes a framed, CRC32-checked copy of the buffer's ring (size,
+// mode, ptr, and every entry) to w. Only the Recent and Oldest raw-byte
+// modes without a TTL are supported; the TTL format (chunk0-4) isn't
+// serialized yet, so round-tripping a TTL buffer would silently make it
+// never expire anything again.
+func (b *Buff) Snapshot(w io.Writer) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.snapshotLocked(w)
+}
+
+// snapshotLocked does the work of Snapshot. Callers must hold b.mutex (read
+// or write).
+func (b *Buff) snapshotLocked(w io.Writer) error {
+	if b.hashed || b.mode == Probabilistic || b.ttl > 0 {
+		return errSnapshotMode
+	}
+
+	var buf bytes.Buffer
+	buf.Write(snapshotMagic[:])
+	buf.WriteByte(snapshotVersion)
+	buf.WriteByte(byte(b.mode))
+	putUint32(&buf, uint32(b.size))
+	putUint32(&buf, uint32(b.ptr))
+
+	for i := 0; i < b.size; i++ {
+		entry := b.data[i]
+		if entry == nil {
+			putInt32(&buf, -1)
+			continue
+		}
+		putInt32(&buf, int32(len(entry)))
+		buf.Write(entry)
+	}
+
+	sum := crc32.ChecksumIEEE(buf.Bytes())
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, sum)
+}
+
+// Restore reads a snapshot written by Snapshot and reconstructs the buffer
+// it describes. An error is returned if the magic, version, or trailing
+// CRC32 do not match.
+func Restore(r io.Reader) (*Buff, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 4 {
+		return nil, errSnapshotCorrupt
+	}
+
+	body, trailer := raw[:len(raw)-4], raw[len(raw)-4:]
+	wantSum := binary.BigEndian.Uint32(trailer)
+	if crc32.ChecksumIEEE(body) != wantSum {
+		return nil, errSnapshotCorrupt
+	}
+
+	r2 := bytes.NewReader(body)
+
+	var magic [4]byte
+	if _, err := io.ReadFull(r2, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != snapshotMagic {
+		return nil, errSnapshotMagic
+	}
+
+	version, err := r2.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != snapshotVersion {
+		return nil, errSnapshotVersion
+	}
+
+	modeByte, err := r2.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	mode := Mode(modeByte)
+
+	size, err := getUint32(r2)
+	if err != nil {
+		return nil, err
+	}
+	ptr, err := getUint32(r2)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := Init(int(size), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < int(size); i++ {
+		length, err := getInt32(r2)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			continue
+		}
+		entry := make([]byte, length)
+		if _, err := io.ReadFull(r2, entry); err != nil {
+			return nil, err
+		}
+		b.data[i] = entry
+	}
+	b.ptr = int(ptr)
+
+	return b, nil
+}
+
+// putUint32 appends v to buf in big-endian order.
+func putUint32(buf *bytes.Buffer, v uint32) {
+	var tmp [4]byte
+	binary.BigEndian.PutUint32(tmp[:], v)
+	buf.Write(tmp[:])
+}
+
+// putInt32 appends v to buf in big-endian order.
+func putInt32(buf *bytes.Buffer, v int32) {
+	putUint32(buf, uint32(v))
+}
+
+// getUint32 reads a big-endian uint32 from r.
+func getUint32(r *bytes.Reader) (uint32, error) {
+	var tmp [4]byte
+	if _, err := io.ReadFull(r, tmp[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(tmp[:]), nil
+}
+
+// getInt32 reads a big-endian int32 from r.
+func getInt32(r *bytes.Reader) (int32, error) {
+	v, err := getUint32(r)
+	return int32(v), err
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -222,6 +223,416 @@ func TestRace(t *testing.T) {
 	}
 }
 
+// TestHashedOverwrite ensures that the oldest digest is overwritten (proper
+// wrap around) and that only the digest, not the original bytes, is stored.
+func TestHashedOverwrite(t *testing.T) {
+	bufferRecent, err := InitHashed(size, Recent, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	bufferOldest, err := InitHashed(size, Oldest, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := []byte("testing")
+	buff := make([]byte, 4)
+
+	bufferRecent.Add(data)
+	bufferOldest.Add(data)
+
+	// loading elements the size of the buffer should bump out the original
+	// element
+	for i := 0; i < size; i++ {
+		intToByte(buff, i)
+		bufferRecent.Add(buff)
+		bufferOldest.Add(buff)
+	}
+
+	// original element should be bumped out after size elements have been added
+	if bufferRecent.Test(data) || bufferOldest.Test(data) {
+		t.Fatalf("data not properly overwritten when buffer is full")
+	}
+
+	// ensure all new elements are present
+	for i := 0; i < size; i++ {
+		intToByte(buff, i)
+		if !bufferRecent.Test(buff) || !bufferOldest.Test(buff) {
+			t.Fatalf("elements are missing on wrap around")
+		}
+	}
+
+	// the original bytes are never retained in hashed mode
+	if bufferRecent.GetRecentRaw() != nil || bufferRecent.GetOldestRaw() != nil {
+		t.Fatalf("raw bytes unexpectedly retained in hashed mode")
+	}
+}
+
+// TestAddCopiesInput ensures that Add copies its input, so mutating the
+// caller's slice afterwards does not change what is stored in the buffer.
+func TestAddCopiesInput(t *testing.T) {
+	bufferRecent, err := Init(size, Recent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := []byte("original")
+	original := make([]byte, len(data))
+	copy(original, data)
+
+	bufferRecent.Add(data)
+
+	// mutate the caller's slice after Add; the buffer must not observe this
+	data[0] = 'X'
+
+	if !bufferRecent.Test(original) {
+		t.Fatalf("buffer contents changed after caller mutated its slice")
+	}
+	if bufferRecent.Test(data) {
+		t.Fatalf("buffer falsely reflects the caller's post-Add mutation")
+	}
+}
+
+// TestSnapshotRoundTrip ensures that ptr, GetRecent/GetOldest ordering, and
+// Test membership are identical before and after a Snapshot/Restore cycle.
+func TestSnapshotRoundTrip(t *testing.T) {
+	buffer, err := Init(8, Recent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// fill past capacity so the ring wraps and ptr is not 0
+	buff := make([]byte, 4)
+	for i := 0; i < 11; i++ {
+		intToByte(buff, i)
+		data := make([]byte, 4)
+		copy(data, buff)
+		buffer.Add(data)
+	}
+
+	var snap bytes.Buffer
+	if err := buffer.Snapshot(&snap); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	restored, err := Restore(&snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if restored.ptr != buffer.ptr {
+		t.Fatalf("ptr mismatch: got %d, want %d", restored.ptr, buffer.ptr)
+	}
+	if !bytes.Equal(restored.GetRecent(), buffer.GetRecent()) {
+		t.Fatalf("GetRecent mismatch after restore")
+	}
+	if !bytes.Equal(restored.GetOldest(), buffer.GetOldest()) {
+		t.Fatalf("GetOldest mismatch after restore")
+	}
+	for i := 0; i < 11; i++ {
+		intToByte(buff, i)
+		if restored.Test(buff) != buffer.Test(buff) {
+			t.Fatalf("Test membership mismatch for element %d", i)
+		}
+	}
+}
+
+// TestRestoreRejectsCorruption ensures that Restore rejects a snapshot whose
+// trailing CRC32 does not match its body.
+func TestRestoreRejectsCorruption(t *testing.T) {
+	buffer, err := Init(4, Recent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	buffer.Add([]byte("testing"))
+
+	var snap bytes.Buffer
+	if err := buffer.Snapshot(&snap); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	corrupt := snap.Bytes()
+	corrupt[0] ^= 0xff
+
+	if _, err := Restore(bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("corrupt snapshot not rejected")
+	}
+}
+
+// TestSnapshotRejectsTTL ensures that Snapshot refuses a TTL-enabled buffer
+// rather than silently producing a restored buffer that never expires
+// anything.
+func TestSnapshotRejectsTTL(t *testing.T) {
+	buffer, err := InitWithTTL(4, Recent, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	buffer.Add([]byte("testing"))
+
+	var snap bytes.Buffer
+	if err := buffer.Snapshot(&snap); err == nil {
+		t.Fatal("TTL buffer not rejected by Snapshot")
+	}
+}
+
+// TestOpenFile ensures that a file-backed buffer survives being reopened,
+// and that a fresh path starts out empty.
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buff.snap")
+
+	buffer, err := OpenFile(path, 4, Recent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if buffer.GetRecent() != nil || buffer.GetOldest() != nil {
+		t.Fatal("fresh OpenFile buffer is not empty")
+	}
+
+	data := []byte("testing")
+	buffer.Add(data)
+
+	reopened, err := OpenFile(path, 4, Recent)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reopened.Test(data) {
+		t.Fatal("data did not survive OpenFile reopen")
+	}
+}
+
+// TestInitWithTTLBadParameters ensures that erroneous parameters return an
+// error.
+func TestInitWithTTLBadParameters(t *testing.T) {
+	_, err := InitWithTTL(0, Recent, time.Minute)
+	if err == nil {
+		t.Fatal("size 0 not captured")
+	}
+	_, err = InitWithTTL(1, 2, time.Minute)
+	if err == nil {
+		t.Fatal("invalid mode not captured")
+	}
+}
+
+// TestTTLExpiration ensures that Test treats an entry as absent once its ttl
+// has elapsed, and that GetOldest skips the expired slot.
+func TestTTLExpiration(t *testing.T) {
+	const ttl = time.Minute
+
+	buffer, err := InitWithTTL(4, Recent, ttl)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	now := time.Unix(0, 0)
+	buffer.clock = func() time.Time { return now }
+
+	data := []byte("testing")
+	buffer.Add(data)
+
+	if !buffer.Test(data) {
+		t.Fatal("entry not found before ttl elapsed")
+	}
+	if !bytes.Equal(buffer.GetOldest(), data) {
+		t.Fatal("GetOldest did not return the fresh entry")
+	}
+
+	// advance the mock clock past the ttl
+	now = now.Add(ttl + time.Second)
+
+	if buffer.Test(data) {
+		t.Fatal("expired entry still reported as present")
+	}
+	if buffer.GetOldest() != nil {
+		t.Fatal("GetOldest did not skip the expired entry")
+	}
+}
+
+// TestSweep ensures that Sweep zeros out expired slots.
+func TestSweep(t *testing.T) {
+	const ttl = time.Minute
+
+	buffer, err := InitWithTTL(4, Recent, ttl)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	now := time.Unix(0, 0)
+	buffer.clock = func() time.Time { return now }
+
+	buffer.Add([]byte("testing"))
+	now = now.Add(ttl + time.Second)
+
+	buffer.Sweep()
+
+	buffer.mutex.RLock()
+	swept := buffer.data[0] == nil
+	buffer.mutex.RUnlock()
+
+	if !swept {
+		t.Fatal("Sweep did not clear the expired slot")
+	}
+}
+
+// TestInitWithTTLAutoBadParameters ensures that erroneous parameters,
+// including a non-positive ttl, are rejected before a ticker is ever
+// started.
+func TestInitWithTTLAutoBadParameters(t *testing.T) {
+	_, err := InitWithTTLAuto(0, Recent, time.Minute)
+	if err == nil {
+		t.Fatal("size 0 not captured")
+	}
+	_, err = InitWithTTLAuto(1, 2, time.Minute)
+	if err == nil {
+		t.Fatal("invalid mode not captured")
+	}
+	_, err = InitWithTTLAuto(1, Recent, 0)
+	if err == nil {
+		t.Fatal("ttl 0 not captured")
+	}
+	_, err = InitWithTTLAuto(1, Recent, -time.Second)
+	if err == nil {
+		t.Fatal("negative ttl not captured")
+	}
+}
+
+// TestInitWithTTLAutoSweeps ensures the background goroutine clears expired
+// slots on its own, without the caller ever calling Sweep.
+func TestInitWithTTLAutoSweeps(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+
+	buffer, err := InitWithTTLAuto(4, Recent, ttl)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer buffer.StopSweep()
+
+	buffer.Add([]byte("testing"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		buffer.mutex.RLock()
+		swept := buffer.data[0] == nil
+		buffer.mutex.RUnlock()
+		if swept {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("background sweep did not clear the expired slot in time")
+}
+
+// TestProbabilisticAddCopiesInput ensures that Add copies its input in
+// Probabilistic mode too, matching the aliasing fix applied to the other
+// modes.
+func TestProbabilisticAddCopiesInput(t *testing.T) {
+	buffer, err := InitProbabilistic(100, 0.01)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := []byte("original")
+	original := make([]byte, len(data))
+	copy(original, data)
+
+	buffer.Add(data)
+
+	// mutate the caller's slice after Add; the buffer must not observe this
+	data[0] = 'X'
+
+	if !bytes.Equal(buffer.GetRecent(), original) {
+		t.Fatalf("buffer contents changed after caller mutated its slice")
+	}
+}
+
+// TestProbabilisticBadParameters ensures that erroneous parameters return an
+// error.
+func TestProbabilisticBadParameters(t *testing.T) {
+	_, err := InitProbabilistic(0, 0.01)
+	if err == nil {
+		t.Fatal("capacity 0 not captured")
+	}
+	_, err = InitProbabilistic(-1, 0.01)
+	if err == nil {
+		t.Fatal("capacity -1 not captured")
+	}
+	_, err = InitProbabilistic(100, 0)
+	if err == nil {
+		t.Fatal("false positive rate 0 not captured")
+	}
+	_, err = InitProbabilistic(100, 1)
+	if err == nil {
+		t.Fatal("false positive rate 1 not captured")
+	}
+}
+
+// TestProbabilisticMembership ensures that every added element always tests
+// positive and that the observed false-positive rate stays within the
+// configured rate.
+func TestProbabilisticMembership(t *testing.T) {
+	const capacity = 1000
+	const fpRate = 0.01
+
+	buffer, err := InitProbabilistic(capacity, fpRate)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	added := make([][]byte, capacity)
+	for i := 0; i < capacity; i++ {
+		buff := make([]byte, 4)
+		intToByte(buff, i)
+		added[i] = buff
+		buffer.Add(buff)
+	}
+
+	// every added element must test positive
+	for i := 0; i < capacity; i++ {
+		if !buffer.Test(added[i]) {
+			t.Fatalf("element falsely reported as absent")
+		}
+	}
+
+	// elements that were never added should rarely test positive
+	const trials = 10000
+	falsePositives := 0
+	for i := capacity; i < capacity+trials; i++ {
+		buff := make([]byte, 4)
+		intToByte(buff, i)
+		if buffer.Test(buff) {
+			falsePositives++
+		}
+	}
+
+	rate := float64(falsePositives) / float64(trials)
+	if rate > fpRate {
+		t.Fatalf("false positive rate %.4f exceeds configured rate %.4f", rate, fpRate)
+	}
+}
+
+// TestProbabilisticEviction ensures that wrapping the ring decrements the
+// counters owned by the evicted element.
+func TestProbabilisticEviction(t *testing.T) {
+	const capacity = 100
+
+	buffer, err := InitProbabilistic(capacity, 0.01)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := []byte("testing")
+	buffer.Add(data)
+
+	buff := make([]byte, 4)
+	for i := 0; i < capacity; i++ {
+		intToByte(buff, i)
+		buffer.Add(buff)
+	}
+
+	if buffer.Test(data) {
+		t.Fatalf("evicted element still reported as a member")
+	}
+}
+
 // intToByte converts an int (32-bit max) to byte array.
 func intToByte(b []byte, v int) {
 	_ = b[3] // memory safety
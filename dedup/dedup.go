@@ -0,0 +1,154 @@
+// Package dedup wires buff.Buff into the AMQP consume and publish paths,
+// giving consumers idempotent delivery without needing a RabbitMQ plugin.
+package dedup
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/streadway/amqp"
+
+	"rabbitmq/buff"
+)
+
+var errNoChannel = errors.New("error: channel must not be nil")
+
+// KeyFunc derives a dedup key from a delivery.
+type KeyFunc func(amqp.Delivery) []byte
+
+// ConsumeOptions configures ConsumeDedup. Consumer, Exclusive, NoLocal,
+// NoWait, and Args are passed straight through to the underlying
+// amqp.Channel.Consume call.
+type ConsumeOptions struct {
+	Consumer  string
+	AutoAck   bool
+	Exclusive bool
+	NoLocal   bool
+	NoWait    bool
+	Args      amqp.Table
+
+	// KeyFunc derives the dedup key from a delivery. It defaults to the
+	// delivery's MessageId, falling back to a content hash of the body when
+	// MessageId is empty.
+	KeyFunc KeyFunc
+
+	// Buff backs the dedup check. It defaults to a 1000-element buff.Buff in
+	// Recent mode.
+	Buff *buff.Buff
+}
+
+// channel is the subset of *amqp.Channel used by Consumer. It exists so
+// ConsumeDedup can be driven by a mock in tests, since streadway/amqp does
+// not expose Channel as an interface.
+type channel interface {
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+}
+
+// Consumer wraps an AMQP channel with dedup support for ConsumeDedup.
+type Consumer struct {
+	ch channel
+}
+
+// NewConsumer returns a new Consumer backed by ch.
+func NewConsumer(ch *amqp.Channel) (*Consumer, error) {
+	if ch == nil {
+		return nil, errNoChannel
+	}
+	return &Consumer{ch: ch}, nil
+}
+
+// ConsumeDedup consumes from queue and drops duplicate deliveries (NACKing
+// them with requeue=false) instead of forwarding them on the returned
+// channel, using opts.Buff to remember keys already seen.
+func (c *Consumer) ConsumeDedup(queue string, opts ConsumeOptions) (<-chan amqp.Delivery, error) {
+	// always ack/nack ourselves so duplicates can be NACKed without requeue
+	deliveries, err := c.ch.Consume(queue, opts.Consumer, false, opts.Exclusive, opts.NoLocal, opts.NoWait, opts.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := opts.Buff
+	if seen == nil {
+		seen, err = buff.Init(1000, buff.Recent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keyFunc := opts.KeyFunc
+	if keyFunc == nil {
+		keyFunc = defaultKeyFunc
+	}
+
+	out := make(chan amqp.Delivery)
+	go func() {
+		defer close(out)
+		for d := range deliveries {
+			key := keyFunc(d)
+			if seen.Test(key) {
+				d.Nack(false, false)
+				continue
+			}
+			seen.Add(key)
+
+			if opts.AutoAck {
+				d.Ack(false)
+			}
+			out <- d
+		}
+	}()
+
+	return out, nil
+}
+
+// defaultKeyFunc derives the dedup key from the delivery's MessageId, falling
+// back to a content hash of the body when MessageId is empty.
+func defaultKeyFunc(d amqp.Delivery) []byte {
+	if d.MessageId != "" {
+		return []byte(d.MessageId)
+	}
+	sum := sha256.Sum256(d.Body)
+	return sum[:]
+}
+
+// publishChannel is the subset of *amqp.Channel used by Publisher.
+type publishChannel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// Publisher wraps an AMQP channel with a Publish helper that sets MessageId
+// to a content-derived value, so a Consumer's defaultKeyFunc dedups on the
+// same key for repeated publishes of identical content.
+type Publisher struct {
+	ch publishChannel
+}
+
+// NewPublisher returns a new Publisher backed by ch.
+func NewPublisher(ch *amqp.Channel) (*Publisher, error) {
+	if ch == nil {
+		return nil, errNoChannel
+	}
+	return &Publisher{ch: ch}, nil
+}
+
+// Publish publishes msg on exchange with routingKey. If msg.MessageId is
+// empty, it is set to a UUID derived from msg.Body so producers and
+// consumers agree on the dedup key.
+func (p *Publisher) Publish(exchange, routingKey string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if msg.MessageId == "" {
+		msg.MessageId = contentUUID(msg.Body)
+	}
+	return p.ch.Publish(exchange, routingKey, mandatory, immediate, msg)
+}
+
+// contentUUID derives a version-5-shaped UUID from body's SHA-256 digest, so
+// repeated publishes of identical content produce the same MessageId.
+func contentUUID(body []byte) string {
+	sum := sha256.Sum256(body)
+	id := sum[:16]
+	id[6] = (id[6] & 0x0f) | 0x50 // version 5
+	id[8] = (id[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
@@ -0,0 +1,184 @@
+package dedup
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// mockChannel is a minimal channel implementation that replays a fixed set
+// of deliveries, so ConsumeDedup can be unit-tested without a real broker.
+type mockChannel struct {
+	deliveries []amqp.Delivery
+}
+
+func (m *mockChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	out := make(chan amqp.Delivery, len(m.deliveries))
+	for _, d := range m.deliveries {
+		out <- d
+	}
+	close(out)
+	return out, nil
+}
+
+// mockAcknowledger records Ack/Nack/Reject calls so tests can assert on
+// which delivery tags were dropped.
+type mockAcknowledger struct {
+	mutex  sync.Mutex
+	acked  []uint64
+	nacked []uint64
+}
+
+func (m *mockAcknowledger) Ack(tag uint64, multiple bool) error {
+	m.mutex.Lock()
+	m.acked = append(m.acked, tag)
+	m.mutex.Unlock()
+	return nil
+}
+
+func (m *mockAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	m.mutex.Lock()
+	m.nacked = append(m.nacked, tag)
+	m.mutex.Unlock()
+	return nil
+}
+
+func (m *mockAcknowledger) Reject(tag uint64, requeue bool) error {
+	return m.Nack(tag, false, requeue)
+}
+
+// TestConsumeDedupDropsDuplicates ensures that deliveries sharing a dedup key
+// are NACKed and not forwarded, while the first occurrence passes through.
+func TestConsumeDedupDropsDuplicates(t *testing.T) {
+	ack := &mockAcknowledger{}
+	ch := &mockChannel{deliveries: []amqp.Delivery{
+		{Acknowledger: ack, DeliveryTag: 1, MessageId: "a"},
+		{Acknowledger: ack, DeliveryTag: 2, MessageId: "a"},
+		{Acknowledger: ack, DeliveryTag: 3, MessageId: "b"},
+	}}
+
+	c := &Consumer{ch: ch}
+	out, err := c.ConsumeDedup("queue", ConsumeOptions{AutoAck: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var forwarded []amqp.Delivery
+	for d := range out {
+		forwarded = append(forwarded, d)
+	}
+
+	if len(forwarded) != 2 {
+		t.Fatalf("expected 2 forwarded deliveries, got %d", len(forwarded))
+	}
+	if forwarded[0].DeliveryTag != 1 || forwarded[1].DeliveryTag != 3 {
+		t.Fatalf("unexpected deliveries forwarded: %+v", forwarded)
+	}
+
+	// allow the goroutine's final Nack to land before asserting
+	time.Sleep(10 * time.Millisecond)
+
+	ack.mutex.Lock()
+	defer ack.mutex.Unlock()
+	if len(ack.nacked) != 1 || ack.nacked[0] != 2 {
+		t.Fatalf("expected delivery tag 2 to be nacked, got %v", ack.nacked)
+	}
+	if len(ack.acked) != 2 {
+		t.Fatalf("expected 2 acked deliveries, got %d", len(ack.acked))
+	}
+}
+
+// TestConsumeDedupKeyFunc ensures a custom KeyFunc is used instead of the
+// MessageId-based default.
+func TestConsumeDedupKeyFunc(t *testing.T) {
+	ack := &mockAcknowledger{}
+	ch := &mockChannel{deliveries: []amqp.Delivery{
+		{Acknowledger: ack, DeliveryTag: 1, MessageId: "a", Body: []byte("same")},
+		{Acknowledger: ack, DeliveryTag: 2, MessageId: "b", Body: []byte("same")},
+	}}
+
+	c := &Consumer{ch: ch}
+	out, err := c.ConsumeDedup("queue", ConsumeOptions{
+		AutoAck: true,
+		KeyFunc: func(d amqp.Delivery) []byte { return d.Body },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var forwarded []amqp.Delivery
+	for d := range out {
+		forwarded = append(forwarded, d)
+	}
+
+	if len(forwarded) != 1 {
+		t.Fatalf("expected 1 forwarded delivery (same body deduped), got %d", len(forwarded))
+	}
+}
+
+// mockPublishChannel records the messages passed to Publish.
+type mockPublishChannel struct {
+	published []amqp.Publishing
+}
+
+func (m *mockPublishChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	m.published = append(m.published, msg)
+	return nil
+}
+
+// TestPublisherSetsContentUUID ensures Publish fills in a content-derived
+// MessageId when the caller did not set one, and that it is stable for
+// identical bodies.
+func TestPublisherSetsContentUUID(t *testing.T) {
+	ch := &mockPublishChannel{}
+	p := &Publisher{ch: ch}
+
+	body := []byte("hello")
+	if err := p.Publish("", "", false, false, amqp.Publishing{Body: body}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := p.Publish("", "", false, false, amqp.Publishing{Body: body}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(ch.published) != 2 {
+		t.Fatalf("expected 2 published messages, got %d", len(ch.published))
+	}
+	if ch.published[0].MessageId == "" {
+		t.Fatalf("MessageId not set")
+	}
+	if ch.published[0].MessageId != ch.published[1].MessageId {
+		t.Fatalf("MessageId not stable for identical content: %q != %q", ch.published[0].MessageId, ch.published[1].MessageId)
+	}
+}
+
+// TestPublisherPreservesMessageId ensures an explicitly set MessageId is left
+// untouched.
+func TestPublisherPreservesMessageId(t *testing.T) {
+	ch := &mockPublishChannel{}
+	p := &Publisher{ch: ch}
+
+	if err := p.Publish("", "", false, false, amqp.Publishing{MessageId: "custom", Body: []byte("hello")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if ch.published[0].MessageId != "custom" {
+		t.Fatalf("expected MessageId to be preserved, got %q", ch.published[0].MessageId)
+	}
+}
+
+// TestNewConsumerNilChannel ensures a nil channel is rejected.
+func TestNewConsumerNilChannel(t *testing.T) {
+	if _, err := NewConsumer(nil); err == nil {
+		t.Fatal("nil channel not captured")
+	}
+}
+
+// TestNewPublisherNilChannel ensures a nil channel is rejected.
+func TestNewPublisherNilChannel(t *testing.T) {
+	if _, err := NewPublisher(nil); err == nil {
+		t.Fatal("nil channel not captured")
+	}
+}